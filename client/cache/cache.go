@@ -0,0 +1,254 @@
+// Package cache implements a content-addressable store for downloaded
+// patch files, keyed by MD5, so reinstalls, multi-install setups and
+// rollbacks can be served from disk instead of the network.
+package cache
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cache is a concurrent-safe, content-addressable store rooted at Dir.
+// Files are stored as <Dir>/<md5[0:2]>/<md5>.
+type Cache struct {
+	Dir     string
+	MaxSize int64         // total bytes to keep, 0 disables size-based eviction
+	MaxAge  time.Duration // max file age to keep, 0 disables age-based eviction
+
+	mu      sync.RWMutex
+	entries map[string]string // md5 -> absolute path
+}
+
+// New creates a Cache rooted at dir, creating it if missing, and loads
+// its existing entries.
+func New(dir string, maxSize int64, maxAge time.Duration) (*Cache, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+	c := &Cache{
+		Dir:     dir,
+		MaxSize: maxSize,
+		MaxAge:  maxAge,
+		entries: make(map[string]string),
+	}
+	if err := c.LoadCache(); err != nil {
+		return nil, fmt.Errorf("load cache: %w", err)
+	}
+	return c, nil
+}
+
+// LoadCache walks Dir and indexes every file by its name, which is
+// expected to be the md5 hash of its contents.
+func (c *Cache) LoadCache() error {
+	entries := make(map[string]string)
+	err := filepath.Walk(c.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		entries[info.Name()] = path
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walk %s: %w", c.Dir, err)
+	}
+	c.mu.Lock()
+	c.entries = entries
+	c.mu.Unlock()
+	return nil
+}
+
+// path returns the on-disk location for md5, sharded by its first two
+// characters to keep any single directory small.
+func (c *Cache) path(hash string) string {
+	return filepath.Join(c.Dir, hash[0:2], hash)
+}
+
+// Has reports whether hash is already cached.
+func (c *Cache) Has(hash string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.entries[hash]
+	return ok
+}
+
+// Fetch hardlinks (falling back to a copy) the cached file for hash to
+// dest on the local filesystem. Callers should still verify dest's
+// checksum afterward.
+func (c *Cache) Fetch(hash string, dest string) error {
+	c.mu.RLock()
+	src, ok := c.entries[hash]
+	c.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%s not in cache", hash)
+	}
+
+	if err := os.Link(src, dest); err == nil {
+		return nil
+	}
+	return copyFile(src, dest)
+}
+
+// Open returns a reader for the cached copy of hash. Use this instead of
+// Fetch when the destination isn't a local path, e.g. writing the bytes
+// on to a remote install target.
+func (c *Cache) Open(hash string) (io.ReadCloser, error) {
+	c.mu.RLock()
+	src, ok := c.entries[hash]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%s not in cache", hash)
+	}
+	return os.Open(src)
+}
+
+// Store copies src into the cache under hash, overwriting any existing
+// entry for it.
+func (c *Cache) Store(hash string, src string) error {
+	dst := c.path(hash)
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return fmt.Errorf("mkdir %s: %w", filepath.Dir(dst), err)
+	}
+	if err := copyFile(src, dst); err != nil {
+		return fmt.Errorf("copy: %w", err)
+	}
+	c.mu.Lock()
+	c.entries[hash] = dst
+	c.mu.Unlock()
+	return nil
+}
+
+type cacheEntry struct {
+	hash string
+	path string
+	info os.FileInfo
+}
+
+// Prune removes entries older than MaxAge, then, if MaxSize is set,
+// removes the least-recently-modified remaining entries until the cache
+// fits under it. It returns the count and total bytes removed.
+func (c *Cache) Prune() (removed int, freed int64, err error) {
+	c.mu.RLock()
+	items := make([]cacheEntry, 0, len(c.entries))
+	for hash, path := range c.entries {
+		info, statErr := os.Stat(path)
+		if statErr != nil {
+			continue
+		}
+		items = append(items, cacheEntry{hash: hash, path: path, info: info})
+	}
+	c.mu.RUnlock()
+
+	now := time.Now()
+	kept := items[:0]
+	for _, it := range items {
+		if c.MaxAge > 0 && now.Sub(it.info.ModTime()) > c.MaxAge {
+			if err = c.remove(it.hash, it.path); err != nil {
+				return removed, freed, err
+			}
+			removed++
+			freed += it.info.Size()
+			continue
+		}
+		kept = append(kept, it)
+	}
+
+	if c.MaxSize > 0 {
+		sort.Slice(kept, func(i, j int) bool {
+			return kept[i].info.ModTime().Before(kept[j].info.ModTime())
+		})
+		var total int64
+		for _, it := range kept {
+			total += it.info.Size()
+		}
+		for i := 0; total > c.MaxSize && i < len(kept); i++ {
+			it := kept[i]
+			if err = c.remove(it.hash, it.path); err != nil {
+				return removed, freed, err
+			}
+			removed++
+			freed += it.info.Size()
+			total -= it.info.Size()
+		}
+	}
+
+	return removed, freed, nil
+}
+
+// Verify recomputes the checksum of every cached file and evicts any
+// whose contents no longer match their filename. It returns the paths
+// removed.
+func (c *Cache) Verify() ([]string, error) {
+	c.mu.RLock()
+	items := make(map[string]string, len(c.entries))
+	for hash, path := range c.entries {
+		items[hash] = path
+	}
+	c.mu.RUnlock()
+
+	var corrupt []string
+	for hash, path := range items {
+		sum, err := md5Checksum(path)
+		if err != nil {
+			return corrupt, fmt.Errorf("checksum %s: %w", path, err)
+		}
+		if sum != hash {
+			if err := c.remove(hash, path); err != nil {
+				return corrupt, err
+			}
+			corrupt = append(corrupt, path)
+		}
+	}
+	return corrupt, nil
+}
+
+func (c *Cache) remove(hash, path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove %s: %w", path, err)
+	}
+	c.mu.Lock()
+	delete(c.entries, hash)
+	c.mu.Unlock()
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", src, err)
+	}
+	defer r.Close()
+
+	w, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", dst, err)
+	}
+	defer w.Close()
+
+	if _, err = io.Copy(w, r); err != nil {
+		return fmt.Errorf("copy %s: %w", dst, err)
+	}
+	return nil
+}
+
+func md5Checksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// store writes content to a temp file, stores it in c under its md5 and
+// returns that md5.
+func store(t *testing.T, c *Cache, content string) string {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.WriteFile(src, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", src, err)
+	}
+	hash, err := md5Checksum(src)
+	if err != nil {
+		t.Fatalf("checksum: %v", err)
+	}
+	if err := c.Store(hash, src); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	return hash
+}
+
+func TestPruneMaxAge(t *testing.T) {
+	c, err := New(t.TempDir(), 0, time.Hour)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	oldHash := store(t, c, "old")
+	newHash := store(t, c, "new")
+
+	oldPath := c.path(oldHash)
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(oldPath, old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+
+	removed, _, err := c.Prune()
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("removed = %d, want 1", removed)
+	}
+	if c.Has(oldHash) {
+		t.Fatalf("expected %s to be pruned for age", oldHash)
+	}
+	if !c.Has(newHash) {
+		t.Fatalf("expected %s to survive, it is within MaxAge", newHash)
+	}
+}
+
+func TestPruneMaxSizeEvictsOldestFirst(t *testing.T) {
+	c, err := New(t.TempDir(), 8, 0)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	oldest := store(t, c, "aaaaa")
+	time.Sleep(10 * time.Millisecond)
+	newest := store(t, c, "bbbbb")
+
+	removed, freed, err := c.Prune()
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if removed != 1 || freed != 5 {
+		t.Fatalf("removed=%d freed=%d, want removed=1 freed=5", removed, freed)
+	}
+	if c.Has(oldest) {
+		t.Fatalf("expected oldest entry %s to be evicted first", oldest)
+	}
+	if !c.Has(newest) {
+		t.Fatalf("expected newest entry %s to survive", newest)
+	}
+}
+
+func TestPruneMaxSizeBoundaryNotExceeded(t *testing.T) {
+	c, err := New(t.TempDir(), 5, 0)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	hash := store(t, c, "aaaaa")
+
+	removed, _, err := c.Prune()
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if removed != 0 {
+		t.Fatalf("removed = %d, want 0 when cache size exactly equals MaxSize", removed)
+	}
+	if !c.Has(hash) {
+		t.Fatalf("expected %s to survive, cache was at MaxSize, not over it", hash)
+	}
+}
+
+func TestVerifyEvictsCorruptEntries(t *testing.T) {
+	c, err := New(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	hash := store(t, c, "good")
+	if err := os.WriteFile(c.path(hash), []byte("tampered"), 0o644); err != nil {
+		t.Fatalf("corrupt entry: %v", err)
+	}
+
+	corrupt, err := c.Verify()
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(corrupt) != 1 || corrupt[0] != c.path(hash) {
+		t.Fatalf("corrupt = %v, want [%s]", corrupt, c.path(hash))
+	}
+	if c.Has(hash) {
+		t.Fatalf("expected corrupt entry %s to be evicted", hash)
+	}
+}
@@ -3,19 +3,29 @@ package client
 import (
 	"archive/zip"
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/ed25519"
 	"crypto/md5"
 	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/cheggaaa/pb/v3"
 	"github.com/inconshreveable/mousetrap"
+	"github.com/xackery/launcheq/client/cache"
+	"github.com/xackery/launcheq/client/disk"
 	"github.com/xackery/launcheq/config"
 	"gopkg.in/yaml.v3"
 
@@ -24,21 +34,144 @@ import (
 
 //go:embed rof2.torrent
 var torrentContent embed.FS
-var isMapsDownloaded bool
+var mapsOnce sync.Once
+var mapsErr error
+
+// defaultPatchWorkers is used when config.Config.PatchWorkers is unset
+const defaultPatchWorkers = 4
+
+// partStagingDir is where in-progress .part downloads are staged. It is
+// always local, even when c.disk points at a remote install target,
+// since resuming a partial download needs a real, seekable local file.
+const partStagingDir = "download"
+
+//go:embed trustedkeys.txt
+var trustedKeysRaw string
+
+// trustedKeyRing is the set of ed25519 public keys allowed to sign
+// filelist_rof.yml and launcheq.exe releases.
+var trustedKeyRing = parseTrustedKeys(trustedKeysRaw)
+
+// ErrSignatureInvalid is returned when a downloaded file's detached
+// signature doesn't validate against the trusted key ring.
+var ErrSignatureInvalid = errors.New("signature verification failed")
+
+func parseTrustedKeys(raw string) []ed25519.PublicKey {
+	var keys []ed25519.PublicKey
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := hex.DecodeString(line)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			continue
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	return keys
+}
 
 // Client wraps the entire UI
 type Client struct {
-	baseName      string
-	patcherUrl    string
-	currentPath   string
-	clientVersion string
-	isPatched     bool
-	patchSummary  string
-	cfg           *config.Config
-	cacheFileList *FileList
-	version       string
-	cacheLog      string
-	httpClient    *http.Client
+	baseName         string
+	patcherUrl       string
+	currentPath      string
+	clientVersion    string
+	isPatched        bool
+	patchSummary     string
+	cfg              *config.Config
+	cacheFileList    *FileList
+	version          string
+	cacheLog         string
+	httpClient       *http.Client
+	downloadCache    *cache.Cache
+	trustKeyOverride string
+	disk             disk.Disk
+
+	logLevel     *slog.LevelVar
+	logFile      *os.File
+	logger       *slog.Logger // stdout + cache + json sink
+	silentLogger *slog.Logger // cache + json sink, for use alongside a progress bar
+
+	cacheMu sync.Mutex
+}
+
+// multiHandler fans a slog.Record out to several handlers.
+type multiHandler struct {
+	handlers []slog.Handler
+}
+
+func (m *multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m.handlers {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	for _, h := range m.handlers {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if err := h.Handle(ctx, r.Clone()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := make([]slog.Handler, len(m.handlers))
+	for i, h := range m.handlers {
+		next[i] = h.WithAttrs(attrs)
+	}
+	return &multiHandler{handlers: next}
+}
+
+func (m *multiHandler) WithGroup(name string) slog.Handler {
+	next := make([]slog.Handler, len(m.handlers))
+	for i, h := range m.handlers {
+		next[i] = h.WithGroup(name)
+	}
+	return &multiHandler{handlers: next}
+}
+
+// cacheWriter appends written records to Client.cacheLog so <baseName>.txt
+// keeps being a readable rendering of the Info+ log records.
+type cacheWriter struct {
+	c *Client
+}
+
+func (w *cacheWriter) Write(p []byte) (int, error) {
+	w.c.cacheMu.Lock()
+	w.c.cacheLog += string(p)
+	w.c.cacheMu.Unlock()
+	return len(p), nil
+}
+
+// parseLogLevel maps a --log-level/LAUNCHEQ_LOG_LEVEL value to a
+// slog.Level, defaulting to Info for anything unrecognized.
+func parseLogLevel(s string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// SetLogLevel adjusts the active log level at runtime, e.g. from a
+// --log-level flag. LAUNCHEQ_LOG_LEVEL is read once at startup to seed
+// the default.
+func (c *Client) SetLogLevel(level string) {
+	c.logLevel.Set(parseLogLevel(level))
 }
 
 // New creates a new client
@@ -62,6 +195,27 @@ func New(version string, patcherUrl string) (*Client, error) {
 		c.baseName = c.baseName[0:strings.Index(c.baseName, ".")]
 	}
 
+	c.logLevel = &slog.LevelVar{}
+	c.logLevel.Set(parseLogLevel(os.Getenv("LAUNCHEQ_LOG_LEVEL")))
+
+	c.logFile, err = os.Create(c.baseName + ".log.json")
+	if err != nil {
+		return nil, fmt.Errorf("create log file: %w", err)
+	}
+
+	dropTime := func(groups []string, a slog.Attr) slog.Attr {
+		if a.Key == slog.TimeKey && len(groups) == 0 {
+			return slog.Attr{}
+		}
+		return a
+	}
+	stdoutHandler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: c.logLevel, ReplaceAttr: dropTime})
+	cacheHandler := slog.NewTextHandler(&cacheWriter{c: c}, &slog.HandlerOptions{Level: slog.LevelInfo, ReplaceAttr: dropTime})
+	jsonHandler := slog.NewJSONHandler(c.logFile, &slog.HandlerOptions{Level: c.logLevel})
+
+	c.logger = slog.New(&multiHandler{handlers: []slog.Handler{stdoutHandler, cacheHandler, jsonHandler}})
+	c.silentLogger = slog.New(&multiHandler{handlers: []slog.Handler{cacheHandler, jsonHandler}})
+
 	c.cfg, err = config.New(context.Background(), c.baseName)
 	if err != nil {
 		return nil, fmt.Errorf("config.new: %w", err)
@@ -72,6 +226,24 @@ func New(version string, patcherUrl string) (*Client, error) {
 		return nil, fmt.Errorf("wd invalid: %w", err)
 	}
 
+	cacheDir := c.cfg.CacheDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(c.currentPath, "cache")
+	}
+	c.downloadCache, err = cache.New(cacheDir, int64(c.cfg.CacheMaxSizeMB)*1024*1024, time.Duration(c.cfg.CacheMaxAgeDays)*24*time.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("cache.new: %w", err)
+	}
+
+	installTarget := c.cfg.InstallTarget
+	if installTarget == "" {
+		installTarget = c.currentPath
+	}
+	c.disk, err = disk.New(installTarget)
+	if err != nil {
+		return nil, fmt.Errorf("disk.new: %w", err)
+	}
+
 	return c, nil
 }
 
@@ -213,6 +385,9 @@ func (c *Client) selfUpdateAndPatch() error {
 
 	err = c.fetchFileList()
 	if err != nil {
+		if errors.Is(err, ErrSignatureInvalid) {
+			return fmt.Errorf("refusing to patch: %w", err)
+		}
 		c.logf("Failed fetch file list, skipping: %s", err)
 		return nil
 	}
@@ -228,6 +403,9 @@ func (c *Client) selfUpdateAndPatch() error {
 			fmt.Println("Your antivirus is blocking", c.baseName, "from being patched. You need to go into your antivirus and recover the file from quarentine.")
 			Exit(1)
 		}
+		if errors.Is(err, ErrSignatureInvalid) {
+			return fmt.Errorf("refusing to self update: %w", err)
+		}
 		c.logf("Failed self update, skipping: %s", err)
 	}
 
@@ -240,7 +418,7 @@ func (c *Client) fetchFileList() error {
 	c.logf("Downloading %s", url)
 	resp, err := client.Get(url)
 	if err != nil {
-		url := fmt.Sprintf("%s/%s/filelist_%s.yml", c.patcherUrl, c.clientVersion, c.clientVersion)
+		url = fmt.Sprintf("%s/%s/filelist_%s.yml", c.patcherUrl, c.clientVersion, c.clientVersion)
 		c.logf("Downloading legacy %s", url)
 		resp, err = client.Get(url)
 		if err != nil {
@@ -253,9 +431,17 @@ func (c *Client) fetchFileList() error {
 	}
 
 	defer resp.Body.Close()
-	fileList := &FileList{}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", url, err)
+	}
+
+	if err := c.verifyDetachedSignature(url+".sig", data); err != nil {
+		return fmt.Errorf("%w: filelist_%s.yml: %s", ErrSignatureInvalid, c.clientVersion, err)
+	}
 
-	err = yaml.NewDecoder(resp.Body).Decode(fileList)
+	fileList := &FileList{}
+	err = yaml.Unmarshal(data, fileList)
 	if err != nil {
 		return fmt.Errorf("decode filelist: %w", err)
 	}
@@ -264,7 +450,60 @@ func (c *Client) fetchFileList() error {
 	return nil
 }
 
+// SetTrustKey adds a hex-encoded ed25519 public key to the trust ring for
+// this run, in addition to the embedded release keys. Intended for the
+// --trust-key flag so testers can validate against a non-production
+// patch server.
+func (c *Client) SetTrustKey(hexKey string) {
+	c.trustKeyOverride = hexKey
+}
+
+func (c *Client) trustedKeys() []ed25519.PublicKey {
+	keys := trustedKeyRing
+	if c.trustKeyOverride == "" {
+		return keys
+	}
+	key, err := hex.DecodeString(c.trustKeyOverride)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		c.logf("Ignoring invalid --trust-key value")
+		return keys
+	}
+	return append(append([]ed25519.PublicKey{}, keys...), ed25519.PublicKey(key))
+}
+
+// verifyDetachedSignature downloads the hex-encoded detached signature at
+// sigURL and checks it against data. Verification succeeds if any key in
+// c.trustedKeys matches.
+func (c *Client) verifyDetachedSignature(sigURL string, data []byte) error {
+	resp, err := c.httpClient.Get(sigURL)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", sigURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("download %s responded %d (not 200)", sigURL, resp.StatusCode)
+	}
+
+	rawSig, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", sigURL, err)
+	}
+
+	sig, err := hex.DecodeString(strings.TrimSpace(string(rawSig)))
+	if err != nil {
+		return fmt.Errorf("decode signature: %w", err)
+	}
+
+	for _, key := range c.trustedKeys() {
+		if ed25519.Verify(key, data, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no trusted key matched")
+}
+
 func (c *Client) selfUpdate() error {
+	start := time.Now()
 	client := c.httpClient
 
 	exeName, err := os.Executable()
@@ -316,11 +555,17 @@ func (c *Client) selfUpdate() error {
 	myHash = strings.ToUpper(strings.TrimSpace(myHash))
 	remoteHash := strings.ToUpper(strings.TrimSpace(string(data)))
 
+	c.logger.Debug("self update check", slog.String("url", url), slog.String("md5", myHash), slog.String("remote_md5", remoteHash))
+
 	if remoteHash == "Not Found" {
 		c.logf("Remote site down, ignoring self update")
 		return nil
 	}
 
+	if err := c.verifyDetachedSignature(url+".sig", data); err != nil {
+		return fmt.Errorf("%w: launcheq-hash.txt: %s", ErrSignatureInvalid, err)
+	}
+
 	if myHash == remoteHash {
 		c.logf("Self update not needed")
 		return nil
@@ -338,11 +583,22 @@ func (c *Client) selfUpdate() error {
 	if resp.StatusCode != 200 {
 		return fmt.Errorf("download %s responded %d (not 200)", url, resp.StatusCode)
 	}
+
+	exeData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", url, err)
+	}
+	if err := c.verifyDetachedSignature(url+".sig", exeData); err != nil {
+		return fmt.Errorf("%w: %s.exe: %s", ErrSignatureInvalid, c.baseName, err)
+	}
+
 	c.logf("Applying update (will be used next launch)")
-	err = selfupdate.Apply(resp.Body, selfupdate.Options{})
+	err = selfupdate.Apply(bytes.NewReader(exeData), selfupdate.Options{})
 	if err != nil {
+		c.logger.Error("self update apply failed", slog.String("url", url), slog.Any("error", err))
 		return fmt.Errorf("apply: %w", err)
 	}
+	c.logger.Info("self update applied", slog.String("url", url), slog.Int64("duration_ms", time.Since(start).Milliseconds()))
 
 	//isErrored := false
 
@@ -381,11 +637,16 @@ func (c *Client) selfUpdate() error {
 	return nil
 }
 
+// logf logs a human-readable Info record to stdout, <baseName>.txt and
+// <baseName>.log.json.
 func (c *Client) logf(format string, a ...interface{}) {
-	text := fmt.Sprintf(format, a...)
-	text += "\n"
-	fmt.Print(text)
-	c.cacheLog += text
+	c.logger.Info(fmt.Sprintf(format, a...))
+}
+
+// cacheLogf logs an Info record to <baseName>.txt and <baseName>.log.json
+// only, for use when a progress bar already occupies the terminal line.
+func (c *Client) cacheLogf(format string, a ...interface{}) {
+	c.silentLogger.Info(fmt.Sprintf(format, a...))
 }
 
 func (c *Client) patch() error {
@@ -393,6 +654,7 @@ func (c *Client) patch() error {
 	start := time.Now()
 
 	fileList := c.cacheFileList
+	c.logger.Debug("patch start", slog.String("version", fileList.Version), slog.Int("downloads", len(fileList.Downloads)), slog.Int("deletes", len(fileList.Deletes)))
 
 	if c.cfg.FileListVersion == fileList.Version {
 		if len(fileList.Version) < 8 {
@@ -409,16 +671,13 @@ func (c *Client) patch() error {
 		totalSize += int64(entry.Size)
 	}
 
-	progressSize := int64(1)
-
-	totalDownloaded := int64(0)
-
 	if len(fileList.Version) < 8 {
 		c.logf("Total patch size: %s", generateSize(int(totalSize)))
 	} else {
 		c.logf("Total patch size: %s, version: %s", generateSize(int(totalSize)), fileList.Version[0:8])
 	}
 
+	var pending []FileEntry
 	isMapsSkippedBefore := false
 	for _, entry := range fileList.Downloads {
 		if strings.Contains(entry.Name, "..") {
@@ -428,33 +687,26 @@ func (c *Client) patch() error {
 
 		if strings.Contains(entry.Name, "/") {
 			newPath := strings.TrimSuffix(entry.Name, filepath.Base(entry.Name))
-			err = os.MkdirAll(newPath, os.ModePerm)
+			err = c.disk.MkdirAll(newPath)
 			if err != nil {
 				return fmt.Errorf("mkdir %s: %w", newPath, err)
 			}
 		}
-		_, err := os.Stat(entry.Name)
+		_, err := c.disk.Stat(entry.Name)
 		if err != nil {
-			if os.IsNotExist(err) {
-				err = c.downloadPatchFile(entry)
-				if err != nil {
-					return fmt.Errorf("download new file: %w", err)
-				}
-				totalDownloaded += int64(entry.Size)
-				progressSize += int64(entry.Size)
-				c.isPatched = true
+			if errors.Is(err, os.ErrNotExist) {
+				pending = append(pending, entry)
 				continue
 			}
 			return fmt.Errorf("stat %s: %w", entry.Name, err)
 		}
 
-		hash, err := md5Checksum(entry.Name)
+		hash, err := c.disk.Hash(entry.Name)
 		if err != nil {
 			return fmt.Errorf("md5checksum: %w", err)
 		}
 
 		if hash == entry.Md5 {
-			progressSize += int64(entry.Size)
 			if strings.HasPrefix(strings.ToLower(entry.Name), "maps/") {
 				if isMapsSkippedBefore {
 					continue
@@ -465,12 +717,19 @@ func (c *Client) patch() error {
 			continue
 		}
 
-		err = c.downloadPatchFile(entry)
-		if err != nil {
-			return fmt.Errorf("download new file: %w", err)
-		}
-		progressSize += int64(entry.Size)
-		totalDownloaded += int64(entry.Size)
+		pending = append(pending, entry)
+	}
+
+	pendingSize := int64(0)
+	for _, entry := range pending {
+		pendingSize += int64(entry.Size)
+	}
+
+	totalDownloaded, err := c.downloadPending(pending, pendingSize)
+	if err != nil {
+		return fmt.Errorf("download pending: %w", err)
+	}
+	if totalDownloaded > 0 {
 		c.isPatched = true
 	}
 
@@ -479,9 +738,9 @@ func (c *Client) patch() error {
 			c.logf("Skipping %s, has .. inside it", entry.Name)
 			continue
 		}
-		fi, err := os.Stat(entry.Name)
+		fi, err := c.disk.Stat(entry.Name)
 		if err != nil {
-			if os.IsNotExist(err) {
+			if errors.Is(err, os.ErrNotExist) {
 				continue
 			}
 			return fmt.Errorf("stat %s: %w", entry.Name, err)
@@ -490,7 +749,7 @@ func (c *Client) patch() error {
 			c.logf("Skipping deleting %s, it is a directory", entry.Name)
 			continue
 		}
-		err = os.Remove(entry.Name)
+		err = c.disk.Remove(entry.Name)
 		if err != nil {
 			c.logf("Failed to delete %s: %s", entry.Name, err)
 			continue
@@ -506,56 +765,460 @@ func (c *Client) patch() error {
 
 	if totalDownloaded == 0 {
 		c.patchSummary = fmt.Sprintf("Finished patch in %0.2f seconds", time.Since(start).Seconds())
+		c.logger.Info("patch finished", slog.Int64("size", 0), slog.Int64("duration_ms", time.Since(start).Milliseconds()))
 		return nil
 	}
 	c.patchSummary = fmt.Sprintf("Finished patch of %s in %0.2f seconds", generateSize(int(totalDownloaded)), time.Since(start).Seconds())
+	c.logger.Info("patch finished", slog.Int64("size", totalDownloaded), slog.Int64("duration_ms", time.Since(start).Milliseconds()))
 
 	return nil
 }
 
-func (c *Client) downloadPatchFile(entry FileEntry) error {
-	client := c.httpClient
-	if !isMapsDownloaded && strings.HasPrefix(strings.ToLower(entry.Name), "maps/") {
-		c.logf("Downloading maps.zip...")
-		url := fmt.Sprintf("%s/maps.zip", c.patcherUrl)
-		resp, err := client.Get(url)
+// Wound describes a file that is missing or whose contents no longer
+// match the patch manifest.
+type Wound struct {
+	Path        string `json:"path"`
+	ExpectedMd5 string `json:"expected_md5"`
+	ActualMd5   string `json:"actual_md5,omitempty"`
+	Size        int    `json:"size"`
+	Missing     bool   `json:"missing"`
+}
+
+// Verify recomputes the MD5 of every file in cacheFileList.Downloads and
+// reports any that are missing or have drifted from entry.Md5. Unlike
+// patch(), it always does a full sweep regardless of cfg.FileListVersion,
+// so users who suspect a partial patch or antivirus interference can
+// force an integrity check without deleting eqemupatch.yml.
+func (c *Client) Verify(ctx context.Context) ([]Wound, error) {
+	if c.cacheFileList == nil {
+		if err := c.fetchFileList(); err != nil {
+			return nil, fmt.Errorf("fetch file list: %w", err)
+		}
+	}
+
+	var wounds []Wound
+	for _, entry := range c.cacheFileList.Downloads {
+		select {
+		case <-ctx.Done():
+			return wounds, ctx.Err()
+		default:
+		}
+
+		hash, err := c.disk.Hash(entry.Name)
 		if err != nil {
-			return fmt.Errorf("download %s: %w", url, err)
+			if errors.Is(err, os.ErrNotExist) {
+				wounds = append(wounds, Wound{Path: entry.Name, ExpectedMd5: entry.Md5, Size: entry.Size, Missing: true})
+				continue
+			}
+			return wounds, fmt.Errorf("md5checksum %s: %w", entry.Name, err)
 		}
-		defer resp.Body.Close()
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("download %s responded %d (not 200)", url, resp.StatusCode)
+		if hash != entry.Md5 {
+			wounds = append(wounds, Wound{Path: entry.Name, ExpectedMd5: entry.Md5, ActualMd5: hash, Size: entry.Size})
 		}
+	}
+
+	c.logger.Info("verify finished", slog.Int("wounds", len(wounds)), slog.Int("checked", len(c.cacheFileList.Downloads)))
+	return wounds, nil
+}
+
+// writeWounds writes wounds as <baseName>-wounds.json and returns the
+// path written.
+func (c *Client) writeWounds(wounds []Wound) (string, error) {
+	path := fmt.Sprintf("%s-wounds.json", c.baseName)
+	data, err := json.MarshalIndent(wounds, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal wounds: %w", err)
+	}
+	if err := os.WriteFile(path, data, os.ModePerm); err != nil {
+		return "", fmt.Errorf("write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// RunVerify implements the --verify flag: it writes <baseName>-wounds.json
+// and returns a non-nil error (callers should exit non-zero) if any
+// wounds were found.
+func (c *Client) RunVerify(ctx context.Context) error {
+	wounds, err := c.Verify(ctx)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
 
-		w, err := os.Create("maps.zip")
+	path, err := c.writeWounds(wounds)
+	if err != nil {
+		return fmt.Errorf("write wounds: %w", err)
+	}
+
+	if len(wounds) == 0 {
+		c.logf("No wounds found, %s is healthy", c.currentPath)
+		return nil
+	}
+	c.logf("Found %d wound(s), see %s", len(wounds), path)
+	return fmt.Errorf("%d wound(s) found", len(wounds))
+}
+
+// RunHeal implements the --heal flag: it re-downloads exactly the wounded
+// files, reusing the concurrent downloader, without touching files that
+// are already up to date.
+func (c *Client) RunHeal(ctx context.Context) error {
+	wounds, err := c.Verify(ctx)
+	if err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+	return c.heal(wounds)
+}
+
+func (c *Client) heal(wounds []Wound) error {
+	if len(wounds) == 0 {
+		c.logf("No wounds to heal")
+		return nil
+	}
+
+	entryByName := make(map[string]FileEntry, len(c.cacheFileList.Downloads))
+	for _, entry := range c.cacheFileList.Downloads {
+		entryByName[entry.Name] = entry
+	}
+
+	var totalSize int64
+	pending := make([]FileEntry, 0, len(wounds))
+	for _, w := range wounds {
+		entry, ok := entryByName[w.Path]
+		if !ok {
+			c.logf("Skipping %s, no longer in file list", w.Path)
+			continue
+		}
+		pending = append(pending, entry)
+		totalSize += int64(entry.Size)
+	}
+
+	downloaded, err := c.downloadPending(pending, totalSize)
+	if err != nil {
+		return fmt.Errorf("heal: %w", err)
+	}
+	c.logf("Healed %s across %d file(s)", generateSize(int(downloaded)), len(pending))
+	return nil
+}
+
+// barTemplate renders filename, bar, speed, ETA and transferred/total bytes
+// for a single in-flight download.
+const barTemplate = `{{string . "prefix"}} {{bar . }} {{speed . }} {{counters . }} {{percent . }} {{rtime . "ETA %s"}}`
+
+// isInteractive reports whether we can draw live progress bars. We fall
+// back to plain textual logging when stdout is piped/redirected, or when
+// launched from Explorer with its output captured.
+func isInteractive() bool {
+	if mousetrap.StartedByExplorer() {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
+
+// downloadPending fetches entries concurrently using a worker pool sized
+// from config.Config.PatchWorkers (defaultPatchWorkers if unset), and
+// returns the total number of bytes downloaded. When stdout is a
+// terminal, progress is shown as one bar per worker plus an aggregate
+// "Total" bar sized to totalSize; otherwise it falls back to c.logf.
+func (c *Client) downloadPending(entries []FileEntry, totalSize int64) (int64, error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	workers := c.cfg.PatchWorkers
+	if workers < 1 {
+		workers = defaultPatchWorkers
+	}
+	if workers > len(entries) {
+		workers = len(entries)
+	}
+
+	jobs := make(chan FileEntry)
+	errs := make(chan error, len(entries))
+
+	var totalDownloaded int64
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	bars := make([]*pb.ProgressBar, workers)
+	var totalBar *pb.ProgressBar
+	if isInteractive() {
+		for i := range bars {
+			bars[i] = pb.ProgressBarTemplate(barTemplate).New(0)
+			bars[i].Set("prefix", "idle")
+		}
+		totalBar = pb.ProgressBarTemplate(`Total {{bar . }} {{speed . }} {{percent . }}`).New(int(totalSize))
+		pool, err := pb.StartPool(append(append([]*pb.ProgressBar{}, bars...), totalBar)...)
 		if err != nil {
-			return fmt.Errorf("create %s: %w", entry.Name, err)
+			bars = make([]*pb.ProgressBar, workers)
+			totalBar = nil
+		} else {
+			defer pool.Stop()
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(bar *pb.ProgressBar) {
+			defer wg.Done()
+			for entry := range jobs {
+				err := c.downloadPatchFile(entry, bar)
+				if err != nil {
+					errs <- fmt.Errorf("%s: %w", entry.Name, err)
+					continue
+				}
+				mu.Lock()
+				totalDownloaded += int64(entry.Size)
+				mu.Unlock()
+				if totalBar != nil {
+					totalBar.Add64(int64(entry.Size))
+				}
+			}
+		}(bars[i])
+	}
+
+	for _, entry := range entries {
+		jobs <- entry
+	}
+	close(jobs)
+	wg.Wait()
+	close(errs)
+
+	if err := <-errs; err != nil {
+		return totalDownloaded, err
+	}
+
+	return totalDownloaded, nil
+}
+
+// downloadPatchFile fetches a single patch entry, retrying once on an
+// integrity mismatch. bar is nil when progress bars are disabled, in
+// which case progress is reported via c.logf instead.
+func (c *Client) downloadPatchFile(entry FileEntry, bar *pb.ProgressBar) error {
+	if strings.HasPrefix(strings.ToLower(entry.Name), "maps/") {
+		// sync.Once.Do blocks every concurrent maps/ worker until the one
+		// real download finishes, so they all observe its actual outcome
+		// instead of racing ahead on the assumption it will succeed.
+		mapsOnce.Do(func() {
+			mapsErr = c.downloadMaps()
+		})
+		return mapsErr
+	}
+
+	if c.downloadCache.Has(entry.Md5) {
+		c.logger.Debug("cache lookup", slog.String("file", entry.Name), slog.String("md5", entry.Md5))
+		if err := c.installFromCache(entry); err == nil {
+			if bar != nil {
+				c.cacheLogf("%s (%s, from cache)", entry.Name, generateSize(entry.Size))
+			} else {
+				c.logf("%s (%s, from cache)", entry.Name, generateSize(entry.Size))
+			}
+			return nil
 		}
-		defer w.Close()
+		c.logger.Warn("cached file failed integrity check, refetching", slog.String("file", entry.Name), slog.String("md5", entry.Md5))
+		if err := c.disk.Remove(entry.Name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove %s: %w", entry.Name, err)
+		}
+	}
 
-		_, err = io.Copy(w, resp.Body)
+	if bar != nil {
+		bar.SetTotal(int64(entry.Size))
+		bar.SetCurrent(0)
+		bar.Set("prefix", entry.Name)
+	} else {
+		c.logf("%s (%s)", entry.Name, generateSize(entry.Size))
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		err := c.downloadRanged(entry, bar)
 		if err != nil {
-			return fmt.Errorf("write %s: %w", entry.Name, err)
+			return fmt.Errorf("download new file: %w", err)
 		}
 
-		//unzip it
-		err = unpack("maps.zip", ".")
+		hash, err := c.disk.Hash(entry.Name)
 		if err != nil {
-			return fmt.Errorf("unzip %s: %w", entry.Name, err)
+			return fmt.Errorf("md5checksum: %w", err)
+		}
+		if hash == entry.Md5 {
+			if bar != nil {
+				c.cacheLogf("%s (%s)", entry.Name, generateSize(entry.Size))
+			}
+			if err := c.downloadCache.Store(entry.Md5, entry.Name); err != nil {
+				c.logger.Warn("failed to cache downloaded file", slog.String("file", entry.Name), slog.Any("error", err))
+			}
+			return nil
 		}
 
-		isMapsDownloaded = true
-		return nil
+		c.logger.Warn("integrity check failed, retrying", slog.String("file", entry.Name), slog.String("md5", hash), slog.String("remote_md5", entry.Md5))
+		if err := c.disk.Remove(entry.Name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove %s: %w", entry.Name, err)
+		}
 	}
-	c.logf("%s (%s)", entry.Name, generateSize(entry.Size))
 
-	w, err := os.Create(entry.Name)
+	return fmt.Errorf("%s failed integrity check after retry", entry.Name)
+}
+
+// downloadRanged downloads entry.Name into a .part file staged under
+// partStagingDir, resuming from any bytes already on disk when the
+// server advertises Accept-Ranges, then installs it onto c.disk.
+// Progress is reported to bar when non-nil.
+func (c *Client) downloadRanged(entry FileEntry, bar *pb.ProgressBar) error {
+	start := time.Now()
+	client := c.httpClient
+	url := fmt.Sprintf("%s/%s/%s", c.cacheFileList.DownloadPrefix, c.clientVersion, entry.Name)
+	partName := filepath.Join(c.currentPath, partStagingDir, entry.Name+".part")
+
+	if err := os.MkdirAll(filepath.Dir(partName), os.ModePerm); err != nil {
+		return fmt.Errorf("mkdir %s: %w", filepath.Dir(partName), err)
+	}
+
+	var offset int64
+	if fi, err := os.Stat(partName); err == nil {
+		offset = fi.Size()
+	}
+
+	acceptsRanges := false
+	if offset > 0 {
+		head, err := client.Head(url)
+		if err == nil {
+			acceptsRanges = head.StatusCode == 200 && head.Header.Get("Accept-Ranges") == "bytes"
+			head.Body.Close()
+		}
+	}
+	c.logger.Debug("download start", slog.String("file", entry.Name), slog.String("url", url), slog.Int64("offset", offset), slog.Bool("resume", acceptsRanges))
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("new request %s: %w", url, err)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if acceptsRanges {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	} else {
+		offset = 0
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("download %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 && resp.StatusCode != 206 {
+		return fmt.Errorf("download %s responded %d (not 200/206)", url, resp.StatusCode)
+	}
+	if resp.StatusCode != 206 {
+		// server ignored our Range request, start over
+		offset = 0
+		flags = os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	}
+
+	w, err := os.OpenFile(partName, flags, os.ModePerm)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", partName, err)
+	}
+
+	var reader io.Reader = resp.Body
+	if bar != nil {
+		bar.SetCurrent(offset)
+		reader = bar.NewProxyReader(resp.Body)
+	}
+
+	_, err = io.Copy(w, reader)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write %s: %w", partName, err)
+	}
+
+	if err = c.installPart(partName, entry.Name); err != nil {
+		return fmt.Errorf("install %s: %w", entry.Name, err)
+	}
+
+	c.logger.Debug("download finished", slog.String("file", entry.Name), slog.String("url", url),
+		slog.Int("size", entry.Size), slog.Int64("duration_ms", time.Since(start).Milliseconds()))
+
+	return nil
+}
+
+// installPart uploads a fully-downloaded .part file, always staged on
+// the local filesystem, onto c.disk under a temporary name and then
+// renames it into place there, so a reader (or a crash mid-upload)
+// never sees a partially-written destName. The local scratch file is
+// removed once the install target has the complete copy.
+func (c *Client) installPart(partName, destName string) error {
+	r, err := os.Open(partName)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", partName, err)
+	}
+	defer r.Close()
+
+	tmpName := destName + ".part"
+	w, err := c.disk.Create(tmpName)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", tmpName, err)
+	}
+
+	_, err = io.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write %s: %w", tmpName, err)
+	}
+
+	if err := c.disk.Rename(tmpName, destName); err != nil {
+		return fmt.Errorf("rename %s: %w", tmpName, err)
+	}
+
+	return os.Remove(partName)
+}
+
+// installFromCache writes entry's cached copy onto c.disk and verifies
+// the installed checksum, the same check downloadPatchFile makes after
+// installPart for a freshly downloaded file, so a cache hit still works
+// against a remote target.
+func (c *Client) installFromCache(entry FileEntry) error {
+	r, err := c.downloadCache.Open(entry.Md5)
+	if err != nil {
+		return fmt.Errorf("open cached %s: %w", entry.Name, err)
+	}
+	defer r.Close()
+
+	w, err := c.disk.Create(entry.Name)
 	if err != nil {
 		return fmt.Errorf("create %s: %w", entry.Name, err)
 	}
-	defer w.Close()
 
-	url := fmt.Sprintf("%s/%s/%s", c.cacheFileList.DownloadPrefix, c.clientVersion, entry.Name)
+	_, err = io.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("write %s: %w", entry.Name, err)
+	}
+
+	hash, err := c.disk.Hash(entry.Name)
+	if err != nil {
+		return fmt.Errorf("md5checksum %s: %w", entry.Name, err)
+	}
+	if hash != entry.Md5 {
+		return fmt.Errorf("%s failed integrity check after cache install", entry.Name)
+	}
+	return nil
+}
+
+// downloadMaps fetches and unpacks the bundled maps.zip, which covers the
+// maps/ entries in one shot rather than one request per file.
+func (c *Client) downloadMaps() error {
+	client := c.httpClient
+	c.logf("Downloading maps.zip...")
+	url := fmt.Sprintf("%s/maps.zip", c.patcherUrl)
 	resp, err := client.Get(url)
 	if err != nil {
 		return fmt.Errorf("download %s: %w", url, err)
@@ -565,10 +1228,23 @@ func (c *Client) downloadPatchFile(entry FileEntry) error {
 		return fmt.Errorf("download %s responded %d (not 200)", url, resp.StatusCode)
 	}
 
+	w, err := os.Create("maps.zip")
+	if err != nil {
+		return fmt.Errorf("create maps.zip: %w", err)
+	}
+	defer w.Close()
+
 	_, err = io.Copy(w, resp.Body)
 	if err != nil {
-		return fmt.Errorf("write %s: %w", entry.Name, err)
+		return fmt.Errorf("write maps.zip: %w", err)
 	}
+
+	//unzip it
+	err = c.unpack("maps.zip", ".")
+	if err != nil {
+		return fmt.Errorf("unzip maps.zip: %w", err)
+	}
+
 	return nil
 }
 
@@ -628,8 +1304,9 @@ func (c *Client) fetchUsername() (string, error) {
 	return "", nil
 }
 
-// unpack unzips the provided path
-func unpack(srcFile string, dstDir string) error {
+// unpack unzips srcFile, which is always staged on the local filesystem,
+// writing its contents under dstDir on the configured install target.
+func (c *Client) unpack(srcFile string, dstDir string) error {
 	ext := filepath.Ext(srcFile)
 	if ext != ".zip" {
 		return fmt.Errorf("invalid extension: %s", ext)
@@ -643,20 +1320,20 @@ func unpack(srcFile string, dstDir string) error {
 	for _, f := range r.File {
 		filePath := filepath.Join(dstDir, f.Name)
 		if f.FileInfo().IsDir() {
-			err := os.MkdirAll(filePath, os.ModePerm)
+			err := c.disk.MkdirAll(filePath)
 			if err != nil {
 				return fmt.Errorf("mkdirall: %w", err)
 			}
 			continue
 		}
 
-		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		if err := c.disk.MkdirAll(filepath.Dir(filePath)); err != nil {
 			return fmt.Errorf("mkdirall: %w", err)
 		}
 
-		outFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+		outFile, err := c.disk.Create(filePath)
 		if err != nil {
-			return fmt.Errorf("openfile: %w", err)
+			return fmt.Errorf("create: %w", err)
 		}
 
 		rc, err := f.Open()
@@ -676,6 +1353,41 @@ func unpack(srcFile string, dstDir string) error {
 	return nil
 }
 
+// CacheCommand handles the `launcheq cache <prune|verify>` subcommand.
+// args is the command line with the leading "cache" token already
+// removed, e.g. []string{"prune"}.
+func (c *Client) CacheCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s cache <prune|verify>", c.baseName)
+	}
+
+	switch args[0] {
+	case "prune":
+		removed, freed, err := c.downloadCache.Prune()
+		if err != nil {
+			return fmt.Errorf("prune: %w", err)
+		}
+		c.logf("Removed %d cached file(s), freed %s", removed, generateSize(int(freed)))
+		return nil
+	case "verify":
+		corrupt, err := c.downloadCache.Verify()
+		if err != nil {
+			return fmt.Errorf("verify: %w", err)
+		}
+		if len(corrupt) == 0 {
+			c.logf("Cache is healthy")
+			return nil
+		}
+		c.logf("Removed %d corrupt cache entr(ies)", len(corrupt))
+		for _, path := range corrupt {
+			c.logf("  %s", path)
+		}
+		return nil
+	default:
+		return fmt.Errorf("usage: %s cache <prune|verify>", c.baseName)
+	}
+}
+
 // Exit closes the client
 func Exit(sig int) {
 	if !mousetrap.StartedByExplorer() {
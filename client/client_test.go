@@ -0,0 +1,148 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrustedKeys(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	valid := hex.EncodeToString(pub)
+
+	raw := "# comment\n\n" + valid + "\n" +
+		"deadbeef\n" + // too short to be a valid public key
+		"not-hex-at-all\n"
+
+	keys := parseTrustedKeys(raw)
+	if len(keys) != 1 {
+		t.Fatalf("parseTrustedKeys returned %d keys, want 1 (comments/blanks/malformed lines should be skipped)", len(keys))
+	}
+	if !keys[0].Equal(pub) {
+		t.Fatalf("parsed key does not match the only valid line")
+	}
+}
+
+func newTestClient(t *testing.T) *Client {
+	t.Helper()
+	return &Client{
+		httpClient: &http.Client{},
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func TestTrustedKeysInvalidOverrideIgnored(t *testing.T) {
+	c := newTestClient(t)
+	c.trustKeyOverride = "not-valid-hex"
+
+	if got := c.trustedKeys(); len(got) != len(trustedKeyRing) {
+		t.Fatalf("trustedKeys() returned %d keys with an invalid override, want the unmodified ring (%d)", len(got), len(trustedKeyRing))
+	}
+}
+
+func TestTrustedKeysOverrideAppended(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	c := newTestClient(t)
+	c.trustKeyOverride = hex.EncodeToString(pub)
+
+	keys := c.trustedKeys()
+	if len(keys) != len(trustedKeyRing)+1 {
+		t.Fatalf("trustedKeys() returned %d keys, want %d (ring + override)", len(keys), len(trustedKeyRing)+1)
+	}
+	if !keys[len(keys)-1].Equal(pub) {
+		t.Fatalf("override key was not appended to the ring")
+	}
+}
+
+func TestVerifyDetachedSignatureAcceptsValidSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	data := []byte("filelist contents")
+	sig := ed25519.Sign(priv, data)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(hex.EncodeToString(sig)))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t)
+	c.trustKeyOverride = hex.EncodeToString(pub)
+
+	if err := c.verifyDetachedSignature(srv.URL+"/filelist.sig", data); err != nil {
+		t.Fatalf("verifyDetachedSignature() = %v, want nil for a correctly signed file", err)
+	}
+}
+
+func TestVerifyDetachedSignatureRejectsUntrustedSignature(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	data := []byte("filelist contents")
+	sig := ed25519.Sign(priv, data)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(hex.EncodeToString(sig)))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t)
+	c.trustKeyOverride = hex.EncodeToString(otherPub)
+
+	if err := c.verifyDetachedSignature(srv.URL+"/filelist.sig", data); err == nil {
+		t.Fatalf("verifyDetachedSignature() = nil, want an error: signature was not made by a trusted key")
+	}
+}
+
+func TestVerifyDetachedSignatureRejectsTamperedData(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	sig := ed25519.Sign(priv, []byte("original contents"))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(hex.EncodeToString(sig)))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t)
+	c.trustKeyOverride = hex.EncodeToString(pub)
+
+	if err := c.verifyDetachedSignature(srv.URL+"/filelist.sig", []byte("tampered contents")); err == nil {
+		t.Fatalf("verifyDetachedSignature() = nil, want an error: data no longer matches the signature")
+	}
+}
+
+func TestVerifyDetachedSignatureErrorsOnMissingSig(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t)
+	err := c.verifyDetachedSignature(srv.URL+"/filelist.sig", []byte("data"))
+	if err == nil {
+		t.Fatalf("verifyDetachedSignature() = nil, want an error for a 404 response")
+	}
+	if errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("a transport-level failure should not be wrapped as %v", ErrSignatureInvalid)
+	}
+}
@@ -0,0 +1,50 @@
+// Package disk abstracts the filesystem operations the patch pipeline
+// needs, so an EverQuest install can live somewhere other than the local
+// disk - a mapped network share, or a remote host reachable over FTP or
+// SFTP.
+package disk
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Disk is the set of filesystem operations the patch pipeline needs.
+type Disk interface {
+	Stat(name string) (FileInfo, error)
+	Open(name string) (io.ReadCloser, error)
+	Create(name string) (io.WriteCloser, error)
+	Remove(name string) error
+	MkdirAll(name string) error
+	Rename(oldName, newName string) error
+	Hash(name string) (string, error)
+}
+
+// FileInfo is the subset of os.FileInfo the patch pipeline needs.
+type FileInfo interface {
+	Size() int64
+	IsDir() bool
+}
+
+// New returns a Disk for target. "ftp://" and "sftp://" targets reach a
+// remote install; anything else is treated as a local path.
+func New(target string) (Disk, error) {
+	switch {
+	case strings.HasPrefix(target, "ftp://"):
+		return newFTP(target)
+	case strings.HasPrefix(target, "sftp://"):
+		return newSFTP(target)
+	default:
+		return newLocal(target), nil
+	}
+}
+
+func md5Reader(r io.Reader) (string, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", fmt.Errorf("hash: %w", err)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,60 @@
+package disk
+
+import (
+	"io"
+	"os"
+)
+
+// localDisk implements Disk against the local OS filesystem, matching
+// launcheq's historical behavior. root is joined with every call so a
+// configured install target of "." behaves exactly as before.
+type localDisk struct {
+	root string
+}
+
+func newLocal(root string) Disk {
+	if root == "" {
+		root = "."
+	}
+	return &localDisk{root: root}
+}
+
+func (d *localDisk) join(name string) string {
+	if d.root == "" || d.root == "." {
+		return name
+	}
+	return d.root + string(os.PathSeparator) + name
+}
+
+func (d *localDisk) Stat(name string) (FileInfo, error) {
+	return os.Stat(d.join(name))
+}
+
+func (d *localDisk) Open(name string) (io.ReadCloser, error) {
+	return os.Open(d.join(name))
+}
+
+func (d *localDisk) Create(name string) (io.WriteCloser, error) {
+	return os.Create(d.join(name))
+}
+
+func (d *localDisk) Remove(name string) error {
+	return os.Remove(d.join(name))
+}
+
+func (d *localDisk) MkdirAll(name string) error {
+	return os.MkdirAll(d.join(name), os.ModePerm)
+}
+
+func (d *localDisk) Rename(oldName, newName string) error {
+	return os.Rename(d.join(oldName), d.join(newName))
+}
+
+func (d *localDisk) Hash(name string) (string, error) {
+	f, err := os.Open(d.join(name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return md5Reader(f)
+}